@@ -0,0 +1,232 @@
+// Copyright 2020 DataStax
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxycore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"golang.org/x/crypto/ocsp"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// RevocationCheckPolicy controls how strictly astra TLS connections check
+// certificate revocation status.
+type RevocationCheckPolicy string
+
+const (
+	RevocationCheckOff      RevocationCheckPolicy = "off"
+	RevocationCheckSoftFail RevocationCheckPolicy = "soft-fail"
+	RevocationCheckHardFail RevocationCheckPolicy = "hard-fail"
+)
+
+// BundleReloader watches an Astra secure connect bundle for changes and
+// atomically swaps the *Bundle used to build future dials' *tls.Config,
+// without dropping sessions that are already established. The bundle can
+// also be reloaded on demand via Reload, e.g. from an admin HTTP endpoint.
+type BundleReloader struct {
+	path   string
+	policy RevocationCheckPolicy
+
+	mu      sync.RWMutex
+	bundle  *Bundle
+	modTime time.Time
+
+	done chan struct{}
+}
+
+// NewBundleReloader loads the bundle at path and polls its mtime every
+// interval so a rotated bundle is picked up without restarting the proxy.
+func NewBundleReloader(path string, policy RevocationCheckPolicy, interval time.Duration) (*BundleReloader, error) {
+	r := &BundleReloader{path: path, policy: policy, done: make(chan struct{})}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	go r.watch(interval)
+	return r, nil
+}
+
+// NewStaticBundleReloader wraps an already-loaded bundle that isn't backed
+// by a watchable file path, e.g. one supplied programmatically rather than
+// read from disk. Reload is a no-op; callers that want the bundle to be
+// picked up after Astra rotates it should use NewBundleReloader instead.
+func NewStaticBundleReloader(bundle *Bundle, policy RevocationCheckPolicy) *BundleReloader {
+	return &BundleReloader{bundle: bundle, policy: policy, done: make(chan struct{})}
+}
+
+// Bundle returns the currently-loaded bundle.
+func (r *BundleReloader) Bundle() *Bundle {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.bundle
+}
+
+func (r *BundleReloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(r.path)
+			if err != nil {
+				continue
+			}
+			r.mu.RLock()
+			changed := info.ModTime().After(r.modTime)
+			r.mu.RUnlock()
+			if changed {
+				_ = r.reload()
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Reload forces an immediate re-read of the bundle, independent of mtime
+// polling, for use from an admin endpoint's reload RPC. It's a no-op for a
+// reloader created with NewStaticBundleReloader, which has no backing path.
+func (r *BundleReloader) Reload() error {
+	if r.path == "" {
+		return nil
+	}
+	return r.reload()
+}
+
+// Close stops the background mtime-polling goroutine.
+func (r *BundleReloader) Close() {
+	close(r.done)
+}
+
+func (r *BundleReloader) reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return fmt.Errorf("unable to stat bundle %s: %v", r.path, err)
+	}
+	bundle, err := OpenBundle(r.path)
+	if err != nil {
+		return fmt.Errorf("unable to load bundle %s: %v", r.path, err)
+	}
+
+	r.mu.Lock()
+	r.bundle = bundle
+	r.modTime = info.ModTime()
+	r.mu.Unlock()
+	return nil
+}
+
+// TLSConfig builds a TLS config for serverName from the currently-loaded
+// bundle, reflecting the latest successful reload.
+func (r *BundleReloader) TLSConfig(serverName string) *tls.Config {
+	r.mu.RLock()
+	bundle := r.bundle
+	r.mu.RUnlock()
+	return copyTLSConfigWithRevocation(bundle, serverName, r.policy)
+}
+
+// checkRevocation checks whether cert has been revoked, preferring a
+// stapled OCSP response (staple) when present and falling back to fetching
+// and caching the CRL named in cert's CRLDistributionPoints extension.
+func checkRevocation(cert *x509.Certificate, staple []byte) error {
+	if len(staple) > 0 {
+		resp, err := ocsp.ParseResponse(staple, nil)
+		if err == nil {
+			if resp.Status == ocsp.Revoked {
+				return fmt.Errorf("certificate revoked (ocsp) at %s", resp.RevokedAt)
+			}
+			if resp.Status == ocsp.Good {
+				return nil
+			}
+		}
+	}
+
+	return checkCRL(cert)
+}
+
+type crlCacheEntry struct {
+	revoked    map[string]struct{}
+	nextUpdate time.Time
+}
+
+var (
+	crlCacheMu sync.Mutex
+	crlCache   = make(map[string]*crlCacheEntry)
+
+	// crlHTTPClient bounds CRL fetches so a stalled distribution point can't
+	// hang every TLS handshake under revocation_check: hard-fail.
+	crlHTTPClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+func checkCRL(cert *x509.Certificate) error {
+	if len(cert.CRLDistributionPoints) == 0 {
+		return nil
+	}
+
+	serial := cert.SerialNumber.String()
+	for _, url := range cert.CRLDistributionPoints {
+		entry, err := fetchCRL(url)
+		if err != nil {
+			continue // try the next distribution point before giving up
+		}
+		if _, revoked := entry.revoked[serial]; revoked {
+			return fmt.Errorf("certificate %s revoked per CRL %s", serial, url)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unable to fetch CRL for certificate %s from any distribution point", serial)
+}
+
+func fetchCRL(url string) (*crlCacheEntry, error) {
+	crlCacheMu.Lock()
+	if entry, ok := crlCache[url]; ok && time.Now().Before(entry.nextUpdate) {
+		crlCacheMu.Unlock()
+		return entry, nil
+	}
+	crlCacheMu.Unlock()
+
+	resp, err := crlHTTPClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch CRL %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := x509.ParseCRL(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse CRL %s: %v", url, err)
+	}
+
+	revoked := make(map[string]struct{}, len(list.TBSCertList.RevokedCertificates))
+	for _, rc := range list.TBSCertList.RevokedCertificates {
+		revoked[rc.SerialNumber.String()] = struct{}{}
+	}
+
+	entry := &crlCacheEntry{revoked: revoked, nextUpdate: list.TBSCertList.NextUpdate}
+
+	crlCacheMu.Lock()
+	crlCache[url] = entry
+	crlCacheMu.Unlock()
+
+	return entry, nil
+}
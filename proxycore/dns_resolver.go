@@ -0,0 +1,219 @@
+// Copyright 2020 DataStax
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxycore
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointEventType describes the kind of change a dynamic EndpointFactory
+// detected between two resolutions.
+type EndpointEventType int
+
+const (
+	EndpointAdded EndpointEventType = iota
+	EndpointRemoved
+)
+
+// EndpointEvent is emitted when a dynamic EndpointFactory's resolved set of
+// endpoints changes, so the connection pool can proactively open or close
+// pools without waiting for a full topology refresh.
+type EndpointEvent struct {
+	Type     EndpointEventType
+	Endpoint Endpoint
+}
+
+// dynamicDNSResolver is an EndpointFactory that keeps re-resolving a set of
+// contact points on a ticker, diffing the result against what it last saw.
+// Contact points beginning with "_" are treated as SRV names (e.g.
+// "_cassandra._tcp.example.com").
+type dynamicDNSResolver struct {
+	contactPoints []string
+	defaultPort   int
+	resolver      *net.Resolver
+
+	mu      sync.RWMutex
+	current map[string]Endpoint
+	ordered []Endpoint
+
+	events chan EndpointEvent
+	done   chan struct{}
+}
+
+// ResolveDynamicDNS returns an EndpointFactory that re-resolves contactPoints
+// every interval, pushing EndpointEvents on the returned channel as hosts are
+// added or removed. This addresses cloud-hosted Cassandra behind a DNS name
+// whose records change after the proxy has already started, which
+// ResolveWithDefaultPort's one-shot lookup can't detect.
+//
+// Note: interval is a fixed polling period, not a TTL-aware one. net.Resolver
+// doesn't expose the TTL of the records it returns, so a record advertising a
+// TTL shorter than interval is not re-resolved any sooner.
+func ResolveDynamicDNS(contactPoints []string, defaultPort int, interval time.Duration) (EndpointFactory, <-chan EndpointEvent, error) {
+	d := &dynamicDNSResolver{
+		contactPoints: contactPoints,
+		defaultPort:   defaultPort,
+		resolver:      net.DefaultResolver,
+		current:       make(map[string]Endpoint),
+		events:        make(chan EndpointEvent, 16),
+		done:          make(chan struct{}),
+	}
+
+	if err := d.resolveOnce(); err != nil {
+		return nil, nil, err
+	}
+
+	go d.run(interval)
+
+	return d, d.events, nil
+}
+
+func (d *dynamicDNSResolver) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = d.resolveOnce() // keep the last-known-good set on a transient resolution failure
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// Close stops the background re-resolution goroutine.
+func (d *dynamicDNSResolver) Close() {
+	close(d.done)
+}
+
+func (d *dynamicDNSResolver) resolveOnce() error {
+	next := make(map[string]Endpoint)
+	var ordered []Endpoint
+
+	add := func(e Endpoint) {
+		if _, ok := next[e.Key()]; ok {
+			return
+		}
+		next[e.Key()] = e
+		ordered = append(ordered, e)
+	}
+
+	for _, cp := range d.contactPoints {
+		if strings.HasPrefix(cp, "_") {
+			endpoints, err := d.resolveSRV(cp)
+			if err != nil {
+				return err
+			}
+			for _, e := range endpoints {
+				add(e)
+			}
+			continue
+		}
+
+		host, port, err := splitHostPortDefault(cp, d.defaultPort)
+		if err != nil {
+			return fmt.Errorf("contact point %s has invalid port: %v", cp, err)
+		}
+
+		addrs, err := d.resolver.LookupHost(context.Background(), host)
+		if err != nil {
+			return fmt.Errorf("unable to resolve contact point %s: %v", cp, err)
+		}
+		for _, addr := range addrs {
+			add(&defaultEndpoint{addr: net.JoinHostPort(addr, strconv.Itoa(port))})
+		}
+	}
+
+	d.diffAndSwap(next, ordered)
+	return nil
+}
+
+// resolveSRV resolves a "_service._proto.name" SRV record and the A/AAAA
+// records of each target, ordered by priority then weight so operators can
+// publish weighted/priority-ordered targets.
+func (d *dynamicDNSResolver) resolveSRV(name string) ([]Endpoint, error) {
+	_, srvs, err := d.resolver.LookupSRV(context.Background(), "", "", name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve SRV record %s: %v", name, err)
+	}
+
+	sort.Slice(srvs, func(i, j int) bool {
+		if srvs[i].Priority != srvs[j].Priority {
+			return srvs[i].Priority < srvs[j].Priority
+		}
+		return srvs[i].Weight > srvs[j].Weight
+	})
+
+	var endpoints []Endpoint
+	for _, srv := range srvs {
+		target := strings.TrimSuffix(srv.Target, ".")
+		addrs, err := d.resolver.LookupHost(context.Background(), target)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve SRV target %s: %v", target, err)
+		}
+		for _, addr := range addrs {
+			endpoints = append(endpoints, &defaultEndpoint{addr: net.JoinHostPort(addr, strconv.Itoa(int(srv.Port)))})
+		}
+	}
+	return endpoints, nil
+}
+
+func (d *dynamicDNSResolver) diffAndSwap(next map[string]Endpoint, ordered []Endpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, endpoint := range next {
+		if _, ok := d.current[key]; !ok {
+			d.sendEvent(EndpointEvent{Type: EndpointAdded, Endpoint: endpoint})
+		}
+	}
+	for key, endpoint := range d.current {
+		if _, ok := next[key]; !ok {
+			d.sendEvent(EndpointEvent{Type: EndpointRemoved, Endpoint: endpoint})
+		}
+	}
+	d.current = next
+	d.ordered = ordered
+}
+
+func (d *dynamicDNSResolver) sendEvent(e EndpointEvent) {
+	select {
+	case d.events <- e:
+	default: // slow consumer; it will catch up on the next full topology refresh
+	}
+}
+
+// ContactPoints returns the last successfully resolved endpoints, in the
+// order they were resolved: SRV-derived endpoints keep the priority (then
+// weight) order of their records, so weighted/priority-ordered targets are
+// preserved rather than shuffled by map iteration.
+func (d *dynamicDNSResolver) ContactPoints() []Endpoint {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	endpoints := make([]Endpoint, len(d.ordered))
+	copy(endpoints, d.ordered)
+	return endpoints
+}
+
+func (d *dynamicDNSResolver) Create(row Row) (Endpoint, error) {
+	return (&defaultEndpointFactory{defaultPort: d.defaultPort}).Create(row)
+}
@@ -78,22 +78,19 @@ func Resolve(contactPoints ...string) (EndpointFactory, error) {
 func ResolveWithDefaultPort(contactPoints []string, defaultPort int) (EndpointFactory, error) {
 	var endpoints []Endpoint
 	for _, cp := range contactPoints {
-		parts := strings.Split(cp, ":")
-		addrs, err := net.LookupHost(parts[0])
+		host, port, err := splitHostPortDefault(cp, defaultPort)
 		if err != nil {
-			return nil, fmt.Errorf("unable to resolve contact point %s: %v", cp, err)
+			return nil, fmt.Errorf("contact point %s has invalid port: %v", cp, err)
 		}
 
-		port := defaultPort
-		if len(parts) > 1 {
-			port, err = strconv.Atoi(parts[1])
-			if err != nil {
-				return nil, fmt.Errorf("contact point %s has invalid port: %v", cp, err)
-			}
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve contact point %s: %v", cp, err)
 		}
+
 		for _, addr := range addrs {
 			endpoints = append(endpoints, &defaultEndpoint{
-				fmt.Sprintf("%s:%d", addr, port),
+				net.JoinHostPort(addr, strconv.Itoa(port)),
 			})
 		}
 	}
@@ -103,6 +100,27 @@ func ResolveWithDefaultPort(contactPoints []string, defaultPort int) (EndpointFa
 	}, nil
 }
 
+// splitHostPortDefault splits a contact point of the form "host", "host:port",
+// "[ipv6]", or "[ipv6]:port" into a host and port, falling back to
+// defaultPort when no port is present. net.SplitHostPort rejects bare IPv6
+// literals like "2001:db8::1" (ambiguous colons) and bracketed literals with
+// no port, so both are handled explicitly.
+func splitHostPortDefault(cp string, defaultPort int) (string, int, error) {
+	if host, port, err := net.SplitHostPort(cp); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return "", 0, err
+		}
+		return host, p, nil
+	}
+
+	host := cp
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	return host, defaultPort, nil
+}
+
 func (d *defaultEndpointFactory) Create(row Row) (Endpoint, error) {
 	peer, err := row.ByName("peer")
 	if err != nil && !errors.Is(err, ColumnNameNotFound) {
@@ -120,7 +138,7 @@ func (d *defaultEndpointFactory) Create(row Row) (Endpoint, error) {
 	}
 
 	return &defaultEndpoint{
-		addr: fmt.Sprintf("%s:%d", addr, d.defaultPort),
+		addr: net.JoinHostPort(addr.String(), strconv.Itoa(d.defaultPort)),
 	}, nil
 }
 
@@ -131,15 +149,28 @@ func (d *defaultEndpointFactory) ContactPoints() []Endpoint {
 type astraResolver struct {
 	contactPoints []Endpoint
 	host          string
-	bundle        *Bundle
+	reloader      *BundleReloader
 }
 
 type astraEndpoint struct {
-	addr      string
-	tlsConfig *tls.Config
+	addr       string
+	serverName string
+	reloader   *BundleReloader
 }
 
+// ResolveAstra resolves an Astra cluster from a single, already-loaded
+// bundle. The bundle is never re-read; use ResolveAstraWithReloader to pick
+// up a rotated bundle without restarting the proxy.
 func ResolveAstra(bundle *Bundle) (EndpointFactory, error) {
+	return ResolveAstraWithReloader(NewStaticBundleReloader(bundle, RevocationCheckOff))
+}
+
+// ResolveAstraWithReloader resolves an Astra cluster the same way as
+// ResolveAstra, except every astraEndpoint built from it builds its
+// *tls.Config from reloader at dial time, so a bundle rotation picked up by
+// reloader is reflected in new connections without dropping existing ones.
+func ResolveAstraWithReloader(reloader *BundleReloader) (EndpointFactory, error) {
+	bundle := reloader.Bundle()
 	var metadata *astraMetadata
 
 	url := fmt.Sprintf("https://%s:%d/metadata", bundle.Host(), bundle.Port())
@@ -166,15 +197,16 @@ func ResolveAstra(bundle *Bundle) (EndpointFactory, error) {
 	var endpoints []Endpoint
 	for _, cp := range metadata.ContactInfo.ContactPoints {
 		endpoints = append(endpoints, &astraEndpoint{
-			addr:      metadata.ContactInfo.SniProxyAddress,
-			tlsConfig: copyTLSConfig(bundle, cp),
+			addr:       metadata.ContactInfo.SniProxyAddress,
+			serverName: cp,
+			reloader:   reloader,
 		})
 	}
 
 	return &astraResolver{
 		contactPoints: endpoints,
 		host:          metadata.ContactInfo.SniProxyAddress,
-		bundle:        bundle,
+		reloader:      reloader,
 	}, nil
 }
 
@@ -189,8 +221,9 @@ func (a *astraResolver) Create(row Row) (Endpoint, error) {
 	}
 	uuid := hostId.(primitive.UUID)
 	return &astraEndpoint{
-		addr:      a.host,
-		tlsConfig: copyTLSConfig(a.bundle, uuid.String()),
+		addr:       a.host,
+		serverName: uuid.String(),
+		reloader:   a.reloader,
 	}, nil
 }
 
@@ -199,7 +232,7 @@ func (a *astraEndpoint) String() string {
 }
 
 func (a *astraEndpoint) Key() string {
-	return fmt.Sprintf("%s:%s", a.addr, a.tlsConfig.ServerName) // TODO: cache!!!
+	return fmt.Sprintf("%s:%s", a.addr, a.serverName)
 }
 
 func (a *astraEndpoint) Addr() string {
@@ -210,11 +243,19 @@ func (a *astraEndpoint) IsResolved() bool {
 	return false
 }
 
+// TlsConfig is rebuilt from the reloader on every call so that a bundle
+// rotation picked up in the background is reflected in the next dial that
+// reads it, without disturbing connections dialed with an earlier config.
 func (a *astraEndpoint) TlsConfig() *tls.Config {
-	return a.tlsConfig
+	return a.reloader.TLSConfig(a.serverName)
 }
 
-func copyTLSConfig(bundle *Bundle, serverName string) *tls.Config {
+// copyTLSConfigWithRevocation builds a *tls.Config for dialing serverName
+// from bundle, verifying the server's certificate against the bundle's CA
+// and, depending on policy, also checking its revocation status from a
+// stapled OCSP response or, failing that, a fetched/cached CRL. This is the
+// TLS config construction BundleReloader.TLSConfig uses on every dial.
+func copyTLSConfigWithRevocation(bundle *Bundle, serverName string, policy RevocationCheckPolicy) *tls.Config {
 	tlsConfig := bundle.TLSConfig()
 	tlsConfig.ServerName = serverName
 	tlsConfig.InsecureSkipVerify = true
@@ -241,6 +282,17 @@ func copyTLSConfig(bundle *Bundle, serverName string) *tls.Config {
 		verifiedChains, err = certs[0].Verify(opts)
 		return err
 	}
+	if policy != RevocationCheckOff {
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return nil
+			}
+			if err := checkRevocation(cs.PeerCertificates[0], cs.OCSPResponse); err != nil && policy == RevocationCheckHardFail {
+				return err
+			}
+			return nil
+		}
+	}
 	return tlsConfig
 }
 
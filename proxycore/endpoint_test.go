@@ -0,0 +1,75 @@
+package proxycore
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+)
+
+func TestSplitHostPortDefault(t *testing.T) {
+	tests := []struct {
+		name     string
+		cp       string
+		wantHost string
+		wantPort int
+	}{
+		{"ipv4", "127.0.0.1", "127.0.0.1", 9042},
+		{"ipv4 with port", "127.0.0.1:9043", "127.0.0.1", 9043},
+		{"bracketed ipv6", "[2001:db8::1]", "2001:db8::1", 9042},
+		{"bracketed ipv6 with port", "[2001:db8::1]:9043", "2001:db8::1", 9043},
+		{"hostname", "cassandra.example.com", "cassandra.example.com", 9042},
+		{"hostname with port", "cassandra.example.com:9043", "cassandra.example.com", 9043},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, err := splitHostPortDefault(tt.cp, 9042)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if host != tt.wantHost || port != tt.wantPort {
+				t.Fatalf("splitHostPortDefault(%q) = (%q, %d), want (%q, %d)", tt.cp, host, port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestDefaultEndpointFactoryCreateIPv6(t *testing.T) {
+	factory := &defaultEndpointFactory{defaultPort: 9042}
+
+	ip := net.ParseIP("2001:db8::1").To16()
+	rs := NewResultSet(&message.RowsResult{
+		Metadata: &message.RowsMetadata{
+			Columns: []*message.ColumnMetadata{
+				{Name: "peer", Type: datatype.Inet},
+				{Name: "rpc_address", Type: datatype.Inet},
+			},
+		},
+		Data: message.RowSet{
+			message.Row{ip, ip},
+		},
+	}, primitive.ProtocolVersion4)
+
+	endpoint, err := factory.Create(rs.Row(0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	host, port, err := net.SplitHostPort(endpoint.Addr())
+	if err != nil {
+		t.Fatalf("endpoint address %q is not dialable: %v", endpoint.Addr(), err)
+	}
+	if net.ParseIP(host) == nil {
+		t.Fatalf("endpoint host %q is not a valid IP", host)
+	}
+	if port != "9042" {
+		t.Fatalf("expected port 9042, got %s", port)
+	}
+	if !strings.HasPrefix(endpoint.Addr(), "[") {
+		t.Fatalf("expected an IPv6 rpc_address to produce a bracketed address, got %q", endpoint.Addr())
+	}
+}
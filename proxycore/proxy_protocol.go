@@ -0,0 +1,201 @@
+// Copyright 2020 DataStax
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxycore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ProxyProtocolPolicy controls whether a client-facing listener expects a
+// PROXY protocol (v1/v2) header to precede the CQL STARTUP frame. This lets
+// cql-proxy recover the true client address when it's fronted by a TCP load
+// balancer (HAProxy, AWS NLB, GCP L4) that prepends one.
+type ProxyProtocolPolicy string
+
+const (
+	ProxyProtocolOff      ProxyProtocolPolicy = "off"
+	ProxyProtocolOptional ProxyProtocolPolicy = "optional"
+	ProxyProtocolRequired ProxyProtocolPolicy = "required"
+)
+
+var proxyProtocolV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// maxV1HeaderLen is the PROXY protocol spec's bound on a v1 header's length
+// (including the trailing CRLF). Enforcing it keeps a client that never
+// sends '\n' after a "PROXY" prefix from making readProxyProtocolV1 buffer
+// unbounded data on a client-facing listener.
+const maxV1HeaderLen = 107
+
+// proxyProtocolConn wraps a net.Conn, overriding RemoteAddr() to return the
+// client address recovered from a PROXY protocol header instead of the
+// address of the intermediate load balancer.
+type proxyProtocolConn struct {
+	net.Conn
+	r          *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// WrapProxyProtocol reads and strips an optional PROXY protocol v1 (ASCII) or
+// v2 (binary) header from conn according to policy, returning a net.Conn
+// whose RemoteAddr() reflects the real client address rather than the LB's.
+// When policy is ProxyProtocolOff, conn is returned unmodified.
+func WrapProxyProtocol(conn net.Conn, policy ProxyProtocolPolicy) (net.Conn, error) {
+	if policy == ProxyProtocolOff {
+		return conn, nil
+	}
+
+	r := bufio.NewReaderSize(conn, 4096)
+	peeked, err := r.Peek(len(proxyProtocolV2Signature))
+	if err != nil {
+		if policy == ProxyProtocolRequired {
+			return nil, fmt.Errorf("unable to read proxy protocol header: %v", err)
+		}
+		return &proxyProtocolConn{Conn: conn, r: r}, nil
+	}
+
+	var addr net.Addr
+	switch {
+	case bytes.Equal(peeked, proxyProtocolV2Signature):
+		addr, err = readProxyProtocolV2(r)
+	case bytes.HasPrefix(peeked, []byte("PROXY")):
+		addr, err = readProxyProtocolV1(r)
+	default:
+		if policy == ProxyProtocolRequired {
+			return nil, fmt.Errorf("connection does not begin with a proxy protocol header")
+		}
+		return &proxyProtocolConn{Conn: conn, r: r}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy protocol header: %v", err)
+	}
+
+	return &proxyProtocolConn{Conn: conn, r: r, remoteAddr: addr}, nil
+}
+
+// readProxyProtocolV1 parses the ASCII PROXY protocol v1 header, e.g.
+// "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n", returning the source
+// address. "PROXY UNKNOWN\r\n" is accepted and returns a nil address.
+func readProxyProtocolV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read v1 header line: %v", err)
+		}
+		if b == '\n' {
+			break
+		}
+		if len(line)+1 >= maxV1HeaderLen { // +1 for the '\n' still to come
+			return nil, fmt.Errorf("v1 header exceeds maximum length of %d bytes", maxV1HeaderLen)
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Split(strings.TrimRight(string(line), "\r"), " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, fmt.Errorf("malformed v1 header: %q", line)
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("malformed v1 header: %q", line)
+	}
+
+	srcIP := net.ParseIP(fields[2])
+	if srcIP == nil {
+		return nil, fmt.Errorf("invalid source address %q", fields[2])
+	}
+	srcPort, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid source port %q", fields[4])
+	}
+
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, nil
+}
+
+// readProxyProtocolV2 parses the binary PROXY protocol v2 header that
+// follows the 12-byte signature already peeked by the caller, returning the
+// source address for AF_INET/AF_INET6 connections.
+func readProxyProtocolV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := readFull(r, header); err != nil {
+		return nil, fmt.Errorf("unable to read v2 header: %v", err)
+	}
+
+	verCmd := header[12]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported proxy protocol version %d", verCmd>>4)
+	}
+	command := verCmd & 0x0F
+
+	famProto := header[13]
+	family := famProto >> 4
+	addrLen := binary.BigEndian.Uint16(header[14:16])
+
+	body := make([]byte, addrLen)
+	if _, err := readFull(r, body); err != nil {
+		return nil, fmt.Errorf("unable to read v2 address block: %v", err)
+	}
+
+	// LOCAL connections (e.g. health checks) carry no meaningful address.
+	if command == 0 {
+		return nil, nil
+	}
+
+	switch family {
+	case 0x1: // AF_INET
+		if len(body) < 12 {
+			return nil, fmt.Errorf("truncated v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x2: // AF_INET6
+		if len(body) < 36 {
+			return nil, fmt.Errorf("truncated v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func readFull(r *bufio.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
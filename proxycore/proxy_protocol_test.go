@@ -0,0 +1,124 @@
+package proxycore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestReadProxyProtocolV1(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"))
+	}()
+
+	conn, err := WrapProxyProtocol(server, ProxyProtocolOptional)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("expected *net.TCPAddr, got %T", conn.RemoteAddr())
+	}
+	if addr.IP.String() != "192.0.2.1" || addr.Port != 56324 {
+		t.Fatalf("unexpected remote addr: %v", addr)
+	}
+}
+
+func TestReadProxyProtocolV1Unknown(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY UNKNOWN\r\n"))
+	}()
+
+	conn, err := WrapProxyProtocol(server, ProxyProtocolOptional)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conn.RemoteAddr() != server.RemoteAddr() {
+		t.Fatalf("expected UNKNOWN to fall back to the underlying connection's RemoteAddr")
+	}
+}
+
+func TestReadProxyProtocolV1Malformed(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY GARBAGE\r\n"))
+	}()
+
+	if _, err := WrapProxyProtocol(server, ProxyProtocolRequired); err == nil {
+		t.Fatal("expected an error for a malformed v1 header")
+	}
+}
+
+func TestReadProxyProtocolV1OversizedHeader(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	payload := append([]byte("PROXY "), bytes.Repeat([]byte("A"), maxV1HeaderLen+10)...)
+	go func() {
+		_, _ = client.Write(payload)
+	}()
+
+	if _, err := WrapProxyProtocol(server, ProxyProtocolOptional); err == nil {
+		t.Fatal("expected an oversized v1 header with no terminating newline to be rejected")
+	}
+}
+
+func TestReadProxyProtocolV2(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	addrBlock := make([]byte, 12)
+	copy(addrBlock[0:4], net.ParseIP("192.0.2.1").To4())
+	copy(addrBlock[4:8], net.ParseIP("192.0.2.2").To4())
+	binary.BigEndian.PutUint16(addrBlock[8:10], 56324)
+	binary.BigEndian.PutUint16(addrBlock[10:12], 443)
+
+	var header bytes.Buffer
+	header.Write(proxyProtocolV2Signature)
+	header.WriteByte(0x21) // version 2, command PROXY
+	header.WriteByte(0x11) // AF_INET, STREAM
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(len(addrBlock)))
+	header.Write(length[:])
+	header.Write(addrBlock)
+
+	go func() {
+		_, _ = client.Write(header.Bytes())
+	}()
+
+	conn, err := WrapProxyProtocol(server, ProxyProtocolOptional)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("expected *net.TCPAddr, got %T", conn.RemoteAddr())
+	}
+	if addr.IP.String() != "192.0.2.1" || addr.Port != 56324 {
+		t.Fatalf("unexpected remote addr: %v", addr)
+	}
+}
+
+func TestWrapProxyProtocolOff(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	conn, err := WrapProxyProtocol(server, ProxyProtocolOff)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conn != server {
+		t.Fatal("expected ProxyProtocolOff to return the connection unmodified")
+	}
+}
@@ -2,14 +2,43 @@ package proxycore
 
 import (
 	"errors"
+	"fmt"
 	"github.com/datastax/go-cassandra-native-protocol/message"
 	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"reflect"
+	"sync"
 )
 
 var (
 	ColumnNameNotFound = errors.New("column name not found")
 )
 
+// DecoderFunc decodes a single CQL value of a given wire type from its raw
+// bytes for the given protocol version.
+type DecoderFunc func(bytes []byte, version primitive.ProtocolVersion) (interface{}, error)
+
+var (
+	customDecodersMu sync.RWMutex
+	customDecoders   = make(map[primitive.DataTypeCode]DecoderFunc)
+)
+
+// RegisterDecoder registers a decoder for a CQL data type, letting callers
+// plug in custom handling (e.g. for UDTs) without forking this module. It's
+// safe to call concurrently with decoding, including after the proxy has
+// started serving traffic.
+func RegisterDecoder(cqlType primitive.DataTypeCode, decoder DecoderFunc) {
+	customDecodersMu.Lock()
+	defer customDecodersMu.Unlock()
+	customDecoders[cqlType] = decoder
+}
+
+func lookupDecoder(cqlType primitive.DataTypeCode) (DecoderFunc, bool) {
+	customDecodersMu.RLock()
+	defer customDecodersMu.RUnlock()
+	decoder, ok := customDecoders[cqlType]
+	return decoder, ok
+}
+
 type ResultSet struct {
 	columnIndexes map[string]int
 	result        *message.RowsResult
@@ -44,7 +73,11 @@ func (rs *ResultSet) RowCount() int {
 }
 
 func (r *Row) ByPos(i int) (interface{}, error) {
-	val, err := DecodeType(r.resultSet.result.Metadata.Columns[i].Type, r.resultSet.version, r.row[i])
+	column := r.resultSet.result.Metadata.Columns[i]
+	if decoder, ok := lookupDecoder(column.Type.Code()); ok {
+		return decoder(r.row[i], r.resultSet.version)
+	}
+	val, err := DecodeType(column.Type, r.resultSet.version, r.row[i])
 	if err != nil {
 		return nil, err
 	}
@@ -58,3 +91,100 @@ func (r *Row) ByName(n string) (interface{}, error) {
 		return r.ByPos(i)
 	}
 }
+
+// Scan decodes row i into dst, which must be a pointer to a struct whose
+// exported fields are tagged with `cql:"column_name"`. Fields tagged for a
+// column that's NULL in the row are left unmodified; pointer fields are left
+// nil. Columns present in the row but not tagged on dst are ignored.
+func (rs *ResultSet) Scan(i int, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("dst must be a pointer to a struct, got %T", dst)
+	}
+	row := rs.Row(i)
+	return scanRow(&row, v.Elem())
+}
+
+// DecodeAll decodes every row in the result set into dstSlice, which must be
+// a pointer to a slice of structs (or pointers to structs) tagged as
+// described by Scan.
+func (rs *ResultSet) DecodeAll(dstSlice interface{}) error {
+	v := reflect.ValueOf(dstSlice)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dstSlice must be a pointer to a slice, got %T", dstSlice)
+	}
+
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	elemIsPtr := elemType.Kind() == reflect.Ptr
+	structType := elemType
+	if elemIsPtr {
+		structType = elemType.Elem()
+	}
+
+	for i := 0; i < rs.RowCount(); i++ {
+		elemPtr := reflect.New(structType)
+		row := rs.Row(i)
+		if err := scanRow(&row, elemPtr.Elem()); err != nil {
+			return fmt.Errorf("row %d: %v", i, err)
+		}
+		if elemIsPtr {
+			slice = reflect.Append(slice, elemPtr)
+		} else {
+			slice = reflect.Append(slice, elemPtr.Elem())
+		}
+	}
+
+	v.Elem().Set(slice)
+	return nil
+}
+
+func scanRow(row *Row, dst reflect.Value) error {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		column := t.Field(i).Tag.Get("cql")
+		if column == "" || column == "-" {
+			continue
+		}
+
+		val, err := row.ByName(column)
+		if err != nil {
+			if errors.Is(err, ColumnNameNotFound) {
+				continue
+			}
+			return err
+		}
+
+		if err := assignValue(dst.Field(i), val); err != nil {
+			return fmt.Errorf("column %q: %v", column, err)
+		}
+	}
+	return nil
+}
+
+func assignValue(fv reflect.Value, val interface{}) error {
+	if val == nil {
+		if fv.Kind() == reflect.Ptr {
+			fv.Set(reflect.Zero(fv.Type()))
+		}
+		return nil
+	}
+
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return assignValue(fv.Elem(), val)
+	}
+
+	rv := reflect.ValueOf(val)
+	switch {
+	case rv.Type().AssignableTo(fv.Type()):
+		fv.Set(rv)
+	case rv.Type().ConvertibleTo(fv.Type()):
+		fv.Set(rv.Convert(fv.Type()))
+	default:
+		return fmt.Errorf("cannot assign %s to field of type %s", rv.Type(), fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package proxycore
+
+import (
+	"testing"
+
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+)
+
+func TestRegisterDecoder(t *testing.T) {
+	RegisterDecoder(datatype.Varchar.Code(), func(bytes []byte, version primitive.ProtocolVersion) (interface{}, error) {
+		return "custom:" + string(bytes), nil
+	})
+	defer delete(customDecoders, datatype.Varchar.Code())
+
+	rs := NewResultSet(&message.RowsResult{
+		Metadata: &message.RowsMetadata{
+			Columns: []*message.ColumnMetadata{
+				{Name: "name", Type: datatype.Varchar},
+			},
+		},
+		Data: message.RowSet{
+			message.Row{[]byte("alice")},
+		},
+	}, primitive.ProtocolVersion4)
+
+	row := rs.Row(0)
+	val, err := row.ByName("name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "custom:alice" {
+		t.Fatalf("expected registered decoder to be used, got %v", val)
+	}
+}
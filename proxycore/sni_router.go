@@ -0,0 +1,191 @@
+// Copyright 2020 DataStax
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxycore
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+// UpstreamConfig describes a single tenant's upstream cluster, as selected by
+// the SNI hostname a driver connects with.
+type UpstreamConfig struct {
+	Name      string `json:"name" yaml:"name"`
+	Keyspace  string `json:"keyspace" yaml:"keyspace"`
+	Username  string `json:"username" yaml:"username"`
+	Password  string `json:"password" yaml:"password"`
+	Endpoints EndpointFactory
+}
+
+// SNIRouter terminates client TLS on cql-proxy's listener and, using the SNI
+// hostname presented in the ClientHello, selects which upstream cluster a
+// connection should be routed to. This mirrors the SNI-based routing Astra
+// already uses on the outbound side (see astraEndpoint/copyTLSConfigWithRevocation), but
+// applied to the proxy's inbound, client-facing side, so a single cql-proxy
+// instance can front many logical clusters.
+type SNIRouter struct {
+	tlsConfig *tls.Config
+	upstreams map[string]*UpstreamConfig
+	fallback  *UpstreamConfig
+}
+
+// NewSNIRouter builds a router over upstreams, keyed by the SNI hostname
+// that selects them. base supplies the certificate(s) and other TLS
+// settings used to serve the handshake. fallback, if non-nil, is used for
+// SNI hostnames with no matching entry in upstreams.
+func NewSNIRouter(base *tls.Config, upstreams map[string]*UpstreamConfig, fallback *UpstreamConfig) *SNIRouter {
+	r := &SNIRouter{upstreams: upstreams, fallback: fallback}
+
+	cfg := base.Clone()
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if _, ok := r.lookup(hello.ServerName); !ok {
+			return nil, fmt.Errorf("no upstream configured for SNI host %q", hello.ServerName)
+		}
+		return cfg, nil
+	}
+	r.tlsConfig = cfg
+
+	return r
+}
+
+func (r *SNIRouter) lookup(serverName string) (*UpstreamConfig, bool) {
+	if u, ok := r.upstreams[serverName]; ok {
+		return u, true
+	}
+	return r.fallback, r.fallback != nil
+}
+
+// Upstream returns the tenant configuration selected for a connection whose
+// TLS handshake has already completed, based on the negotiated ServerName.
+// Callers use this to rewrite the STARTUP/AUTH exchange so tenants are
+// isolated from one another.
+func (r *SNIRouter) Upstream(conn *tls.Conn) (*UpstreamConfig, error) {
+	serverName := conn.ConnectionState().ServerName
+	if u, ok := r.lookup(serverName); ok {
+		return u, nil
+	}
+	return nil, fmt.Errorf("no upstream configured for SNI host %q", serverName)
+}
+
+// Listen wraps l so that every accepted connection is TLS-terminated using
+// the router's TLS configuration, shared by all tenants, which rejects
+// handshakes whose SNI host selects no upstream; the resulting connections
+// are ready for Upstream to inspect.
+func (r *SNIRouter) Listen(l net.Listener) net.Listener {
+	return tls.NewListener(l, r.tlsConfig)
+}
+
+// upstreamsFile is the on-disk shape LoadUpstreams parses, in either YAML or
+// JSON, e.g.:
+//
+//	upstreams:
+//	  - sni: tenant1.proxy.example.com
+//	    name: tenant1
+//	    keyspace: ks1
+//	    username: user1
+//	    password: pass1
+//	    contact_points: ["10.0.0.1", "10.0.0.2"]
+//	    port: 9042
+type upstreamsFile struct {
+	Upstreams []struct {
+		SNI           string   `json:"sni" yaml:"sni"`
+		Name          string   `json:"name" yaml:"name"`
+		Keyspace      string   `json:"keyspace" yaml:"keyspace"`
+		Username      string   `json:"username" yaml:"username"`
+		Password      string   `json:"password" yaml:"password"`
+		ContactPoints []string `json:"contact_points" yaml:"contact_points"`
+		Port          int      `json:"port" yaml:"port"`
+	} `json:"upstreams" yaml:"upstreams"`
+}
+
+// LoadUpstreams reads a YAML (.yaml/.yml) or JSON (.json) file, selected by
+// its extension, mapping SNI hostnames to upstream cluster configurations,
+// resolving each entry's contact_points into an EndpointFactory.
+func LoadUpstreams(path string) (map[string]*UpstreamConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read upstreams file %s: %v", path, err)
+	}
+
+	var file upstreamsFile
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err = yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("unable to parse upstreams file %s: %v", path, err)
+		}
+	case ".json":
+		if err = json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("unable to parse upstreams file %s: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported upstreams file extension %q", ext)
+	}
+
+	upstreams := make(map[string]*UpstreamConfig, len(file.Upstreams))
+	for _, u := range file.Upstreams {
+		if u.SNI == "" {
+			return nil, fmt.Errorf("upstream %q is missing a sni hostname", u.Name)
+		}
+
+		port := u.Port
+		if port == 0 {
+			port = 9042
+		}
+		endpoints, err := ResolveWithDefaultPort(u.ContactPoints, port)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve upstream %q contact points: %v", u.Name, err)
+		}
+
+		upstreams[u.SNI] = &UpstreamConfig{
+			Name:      u.Name,
+			Keyspace:  u.Keyspace,
+			Username:  u.Username,
+			Password:  u.Password,
+			Endpoints: endpoints,
+		}
+	}
+	return upstreams, nil
+}
+
+// RewriteAuthResponse builds the AuthResponse cql-proxy should forward to
+// upstream in place of the tenant's own, substituting upstream's configured
+// credentials. This is what keeps a tenant's SASL PLAIN credentials (valid
+// only against the proxy) from ever reaching the shared upstream cluster.
+func RewriteAuthResponse(upstream *UpstreamConfig) *message.AuthResponse {
+	token := make([]byte, 0, len(upstream.Username)+len(upstream.Password)+2)
+	token = append(token, 0)
+	token = append(token, upstream.Username...)
+	token = append(token, 0)
+	token = append(token, upstream.Password...)
+	return &message.AuthResponse{Token: token}
+}
+
+// InitialKeyspaceQuery returns the "USE <keyspace>" query cql-proxy should
+// issue against upstream right after STARTUP/AUTH completes, binding the new
+// session to the tenant's keyspace before any client query is proxied
+// through. It returns nil when upstream has no configured keyspace.
+func InitialKeyspaceQuery(upstream *UpstreamConfig) *message.Query {
+	if upstream.Keyspace == "" {
+		return nil
+	}
+	return &message.Query{Query: fmt.Sprintf("USE %s", upstream.Keyspace)}
+}